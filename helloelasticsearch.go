@@ -1,15 +1,55 @@
 package main
 
 import (
+	"bufio"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
+	"os"
+	"os/signal"
 	"reflect"
+	"strconv"
+	"strings"
 	"time"
 
 	es "gopkg.in/olivere/elastic.v2"
 )
 
+var (
+	urls                = flag.String("url", "http://127.0.0.1:9200", "comma-separated list of Elasticsearch URLs")
+	user                = flag.String("user", "", "username for basic auth")
+	pass                = flag.String("pass", "", "password for basic auth")
+	sniff               = flag.Bool("sniff", true, "enable sniffing of the cluster's nodes")
+	healthcheckInterval = flag.Duration("healthcheck-interval", 60*time.Second, "interval between health checks of the nodes")
+	maxRetries          = flag.Int("max-retries", 5, "maximum number of retries per request")
+	verbose             = flag.Bool("verbose", false, "enable info logging to stdout")
+	debug               = flag.Bool("debug", false, "enable trace logging to stdout")
+
+	loadFile      = flag.String("load", "", "path to a newline-delimited JSON file of tweets to bulk index")
+	loadBatchSize = flag.Int("load-batch-size", 1000, "number of tweets to send per bulk request with -load")
+
+	tail         = flag.Bool("tail", false, "follow the twitter index for new tweets instead of running the one-shot search")
+	tailInterval = flag.Duration("tail-interval", 2*time.Second, "polling interval for -tail")
+
+	suggestPrefix = flag.String("suggest", "", "prefix to autocomplete against the twitter index's suggest_field")
+
+	near   = flag.String("near", "", "lat,lon to search near using the twitter index's location geo_point")
+	radius = flag.Float64("radius", 10, "radius in km for -near")
+)
+
+// defaultLoadBatchSize is used by LoadTweets when called with a non-positive
+// batchSize.
+const defaultLoadBatchSize = 1000
+
+// defaultTailInterval is used by Tail when called with a non-positive
+// interval.
+const defaultTailInterval = 2 * time.Second
+
+// tailPollSize bounds each Tail poll so a backlog drains in a handful of
+// iterations instead of trickling in 10 hits at a time.
+const tailPollSize = 1000
+
 // Tweet is a structure used for serializing/deserializing data in Elasticsearch.
 type Tweet struct {
 	User     string                `json:"user"`
@@ -58,11 +98,208 @@ const mapping = `
 	}
 }`
 
+// newESClient builds an Elasticsearch client from the command-line flags.
+func newESClient() (*es.Client, error) {
+	options := []es.ClientOptionFunc{
+		es.SetURL(strings.Split(*urls, ",")...),
+		es.SetSniff(*sniff),
+		es.SetMaxRetries(*maxRetries),
+		es.SetHealthcheckInterval(*healthcheckInterval),
+		es.SetErrorLog(log.New(os.Stderr, "ES ", log.LstdFlags)),
+	}
+	if *user != "" {
+		options = append(options, es.SetBasicAuth(*user, *pass))
+	}
+	if *verbose {
+		options = append(options, es.SetInfoLog(log.New(os.Stdout, "ES ", log.LstdFlags)))
+	}
+	if *debug {
+		options = append(options, es.SetTraceLog(log.New(os.Stdout, "ES ", log.LstdFlags)))
+	}
+	return es.NewClient(options...)
+}
+
+// LoadTweets streams a newline-delimited JSON file of Tweet records and
+// bulk-indexes them into the twitter index in batches.
+func LoadTweets(client *es.Client, path string, batchSize int) (indexed, failed int, err error) {
+	if batchSize <= 0 {
+		batchSize = defaultLoadBatchSize
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	var batch []es.BulkableRequest
+	id := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var t Tweet
+		if err := json.Unmarshal([]byte(line), &t); err != nil {
+			return indexed, failed, fmt.Errorf("decoding tweet: %v", err)
+		}
+		id++
+		batch = append(batch, es.NewBulkIndexRequest().Index("twitter").Type("tweet").Id(strconv.Itoa(id)).Doc(t))
+		if len(batch) >= batchSize {
+			n, fc, err := submitBatch(client, batch)
+			indexed += n
+			failed += fc
+			if err != nil {
+				return indexed, failed, err
+			}
+			batch = nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return indexed, failed, err
+	}
+	if len(batch) > 0 {
+		n, fc, err := submitBatch(client, batch)
+		indexed += n
+		failed += fc
+		if err != nil {
+			return indexed, failed, err
+		}
+	}
+	return indexed, failed, nil
+}
+
+// submitBatch sends a batch of bulk requests, retrying with exponential
+// backoff on 429 responses.
+func submitBatch(client *es.Client, batch []es.BulkableRequest) (indexed, failed int, err error) {
+	backoff := 100 * time.Millisecond
+	for attempt := 0; attempt < 5; attempt++ {
+		bulk := client.Bulk()
+		for _, r := range batch {
+			bulk = bulk.Add(r)
+		}
+		resp, err := bulk.Do()
+		if err != nil {
+			return indexed, failed, err
+		}
+
+		failedItems := resp.Failed()
+		throttled := false
+		for _, item := range failedItems {
+			if item.Status == 429 {
+				throttled = true
+				break
+			}
+		}
+		if !throttled {
+			return len(resp.Items) - len(failedItems), len(failedItems), nil
+		}
+
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+	return indexed, failed, fmt.Errorf("bulk indexing still throttled after retries")
+}
+
+// Tail polls the index for tweets newer than the last-seen timestamp,
+// printing new hits as they arrive.
+func Tail(client *es.Client, index string, interval time.Duration) error {
+	if interval <= 0 {
+		interval = defaultTailInterval
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt)
+	defer signal.Stop(sigCh)
+
+	var since time.Time
+	var t Tweet
+	ttyp := reflect.TypeOf(t)
+
+	for {
+		query := es.NewRangeQuery("created").Gt(since)
+		searchResult, err := client.Search().
+			Index(index).
+			Query(query).
+			Sort("created", true).
+			Size(tailPollSize).
+			Do()
+		if err != nil {
+			return err
+		}
+
+		for _, item := range searchResult.Each(ttyp) {
+			tw, ok := item.(Tweet)
+			if !ok {
+				continue
+			}
+			fmt.Printf("%s %s: %s\n", tw.Created.Format(time.RFC3339), tw.User, tw.Message)
+			if tw.Created.After(since) {
+				since = tw.Created
+			}
+		}
+
+		select {
+		case <-sigCh:
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Suggest runs the completion suggester against suggest_field for the given
+// prefix and prints the returned options.
+func Suggest(client *es.Client, prefix string) error {
+	suggester := es.NewCompletionSuggester("tweet-suggest").Text(prefix).Field("suggest_field")
+	result, err := client.Suggest().Index("twitter").Suggester(suggester).Do()
+	if err != nil {
+		return err
+	}
+	for _, suggestion := range result["tweet-suggest"] {
+		for _, option := range suggestion.Options {
+			fmt.Printf("Suggestion: %s (score %f)\n", option.Text, option.Score)
+		}
+	}
+	return nil
+}
+
+// SearchNearby returns the tweets within radiusKm of the given point,
+// ordered by distance, using the twitter index's location geo_point.
+// Only the first page of hits (Elasticsearch's default of 10) is returned;
+// further hits are not fetched.
+func SearchNearby(client *es.Client, lat, lon, radiusKm float64) ([]Tweet, error) {
+	geoFilter := es.NewGeoDistanceFilter("location").Lat(lat).Lon(lon).Distance(fmt.Sprintf("%fkm", radiusKm))
+	filteredQuery := es.NewFilteredQuery(es.NewMatchAllQuery()).Filter(geoFilter)
+	geoSort := es.NewGeoDistanceSort("location").Point(lat, lon).Order(true).Unit("km")
+
+	searchResult, err := client.Search().
+		Index("twitter").
+		Query(filteredQuery).
+		SortBy(geoSort).
+		Do()
+	if err != nil {
+		return nil, err
+	}
+
+	var tweets []Tweet
+	var t Tweet
+	for _, item := range searchResult.Each(reflect.TypeOf(t)) {
+		if tw, ok := item.(Tweet); ok {
+			tweets = append(tweets, tw)
+		}
+	}
+	return tweets, nil
+}
+
 func main() {
-	// Obtain a client and connect to the default Elasticsearch installation
-	// on 127.0.0.1:9200. Of course you can configure your client to connect
-	// to other hosts and configure it in various other ways.
-	client, err := es.NewClient()	
+	flag.Parse()
+
+	// Obtain a client, configured from the flags above. By default it
+	// connects to the Elasticsearch installation on 127.0.0.1:9200, but
+	// -url, -user/-pass, -sniff, -healthcheck-interval, -max-retries,
+	// -verbose and -debug let you point it at other setups.
+	client, err := newESClient()
 	if err != nil {
 		// Handle error
 		log.Panicf("error: %v, when creating a new client.\n", err)
@@ -76,14 +313,6 @@ func main() {
 	}
 	fmt.Printf("Elasticsearch returned with code %d and version %s\n", code, info.Version.Number)
 
-	// Getting the ES version number.
-	esversion, err := client.ElasticsearchVersion("http://127.0.0.1:9200")
-	if err != nil {
-		// Handle error
-		log.Panicf("error: %v, when getting ES version number.\n", err)
-	}
-	fmt.Printf("Elasticsearch version %s\n", esversion)
-
 	// Use the IndexExists service to check if a specified index exists.
 	exists, err := client.IndexExists("twitter").Do()
 	if err != nil {
@@ -125,33 +354,50 @@ func main() {
 		fmt.Println("Index twitter does no exist.")
 	}
 
-	// Index a tweet using JSON serialization
-	tweet1 := Tweet{User: "olivere", Message: "Take Five", Retweets: 0}
-	put1, err := client.Index().
-	    Index("twitter").
-	    Type("tweet").
-	    Id("1").
-	    BodyJson(tweet1).
-	    Do()
-	if err != nil {
-	    // Handle error
-		log.Panicf("error: %v, when indexing a tweet.\n", err)
+	// Seed the index at scale from a newline-delimited JSON file instead of
+	// hard-coding tweets, when -load is given.
+	if *loadFile != "" {
+		indexed, failed, err := LoadTweets(client, *loadFile, *loadBatchSize)
+		if err != nil {
+			log.Panicf("error: %v, when loading tweets from %s.\n", err, *loadFile)
+		}
+		fmt.Printf("Loaded %d tweets (%d failed) from %s\n", indexed, failed, *loadFile)
 	}
-	fmt.Printf("Indexed tweet %s to index %s, type %s\n", put1.Id, put1.Index, put1.Type)
 
-	// Index a second tweet (by string)
-	tweet2 := `{"user" : "olivere", "message" : "It's a Raggy Waltz"}`
-	put2, err := client.Index().
-		Index("twitter").
-		Type("tweet").
-		Id("2").
-		BodyString(tweet2).
-		Do()
-	if err != nil {
-		// Handle error
-		log.Panicf("error: %v, when indexing a tweet.\n", err)
+	// The hardcoded samples below reuse ids "1" and "2", which -load also
+	// assigns to the first docs it streams in, so skip them when -load is
+	// given instead of overwriting what was just loaded.
+	if *loadFile == "" {
+		// Index a tweet using JSON serialization
+		tweet1 := Tweet{User: "olivere", Message: "Take Five", Retweets: 0}
+		tweet1.Suggest = es.NewSuggestField().Input("olivere", "Take", "Five").Weight(tweet1.Retweets)
+		tweet1.Location = "48.137154,11.576124"
+		put1, err := client.Index().
+		    Index("twitter").
+		    Type("tweet").
+		    Id("1").
+		    BodyJson(tweet1).
+		    Do()
+		if err != nil {
+		    // Handle error
+			log.Panicf("error: %v, when indexing a tweet.\n", err)
+		}
+		fmt.Printf("Indexed tweet %s to index %s, type %s\n", put1.Id, put1.Index, put1.Type)
+
+		// Index a second tweet (by string)
+		tweet2 := `{"user":"olivere","message":"It's a Raggy Waltz","location":"48.137154,11.576124","suggest_field":{"input":["olivere","It's","a","Raggy","Waltz"],"weight":0}}`
+		put2, err := client.Index().
+			Index("twitter").
+			Type("tweet").
+			Id("2").
+			BodyString(tweet2).
+			Do()
+		if err != nil {
+			// Handle error
+			log.Panicf("error: %v, when indexing a tweet.\n", err)
+		}
+		fmt.Printf("Indexed tweet %s to index %s, type %s\n", put2.Id, put2.Index, put2.Type)
 	}
-	fmt.Printf("Indexed tweet %s to index %s, type %s\n", put2.Id, put2.Index, put2.Type)
 
 
 	// GET tweet with specified ID
@@ -180,6 +426,49 @@ func main() {
 		log.Panicf("error: %v, when flushing index.\n", err)
 	}
 
+	// With -near, search the location geo_point instead of running the rest
+	// of the demo.
+	if *near != "" {
+		parts := strings.SplitN(*near, ",", 2)
+		if len(parts) != 2 {
+			log.Panicf("error: -near must be in the form lat,lon, got %q.\n", *near)
+		}
+		lat, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+		if err != nil {
+			log.Panicf("error: %v, when parsing -near latitude.\n", err)
+		}
+		lon, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+		if err != nil {
+			log.Panicf("error: %v, when parsing -near longitude.\n", err)
+		}
+		tweets, err := SearchNearby(client, lat, lon, *radius)
+		if err != nil {
+			log.Panicf("error: %v, when searching nearby tweets.\n", err)
+		}
+		for _, t := range tweets {
+			fmt.Printf("Tweet by %s near (%s): %s\n", t.User, t.Location, t.Message)
+		}
+		return
+	}
+
+	// With -suggest, exercise the completion suggester instead of running
+	// the rest of the demo.
+	if *suggestPrefix != "" {
+		if err := Suggest(client, *suggestPrefix); err != nil {
+			log.Panicf("error: %v, when suggesting completions.\n", err)
+		}
+		return
+	}
+
+	// With -tail, follow the twitter index for new tweets instead of running
+	// the one-shot search below.
+	if *tail {
+		if err := Tail(client, "twitter", *tailInterval); err != nil {
+			log.Panicf("error: %v, when tailing the twitter index.\n", err)
+		}
+		return
+	}
+
 	// Search with a term query.
 	termQuery := es.NewTermQuery("user", "olivere")
 	searchResult, err := client.Search().